@@ -2,17 +2,25 @@ package test
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 )
 
@@ -101,6 +109,75 @@ func BenchmarkPgxInsertCopy(b *testing.B) {
 			b.Fatalf("pgx copy from failed: %v", err)
 		}
 	}
+
+	b.ReportMetric(float64(totalRows)*float64(b.N)/b.Elapsed().Seconds(), "rows/sec")
+}
+
+// =================== 批量写入基准测试 ===================
+
+const bulkInsertRows = 10000
+
+func BenchmarkGormCreateInBatches(b *testing.B) {
+	for b.Loop() {
+		users := make([]User, bulkInsertRows)
+		for j := range bulkInsertRows {
+			users[j] = User{
+				Name:  fmt.Sprintf("Batch User %d", j),
+				Email: fmt.Sprintf("batch_user_%d@example.com", j),
+			}
+		}
+		if err := dbGorm.CreateInBatches(users, 1000).Error; err != nil {
+			b.Fatalf("gorm CreateInBatches failed: %v", err)
+		}
+	}
+
+	b.ReportMetric(float64(bulkInsertRows)*float64(b.N)/b.Elapsed().Seconds(), "rows/sec")
+}
+
+func BenchmarkGormMultiValuesInsert(b *testing.B) {
+	for b.Loop() {
+		var sb strings.Builder
+		sb.WriteString("INSERT INTO users (name, email, created_at) VALUES ")
+		args := make([]any, 0, bulkInsertRows*2)
+		for j := range bulkInsertRows {
+			if j > 0 {
+				sb.WriteString(",")
+			}
+			sb.WriteString("(?,?,NOW())")
+			args = append(args, fmt.Sprintf("Multi User %d", j), fmt.Sprintf("multi_user_%d@example.com", j))
+		}
+		if err := dbGorm.Exec(sb.String(), args...).Error; err != nil {
+			b.Fatalf("gorm multi-values insert failed: %v", err)
+		}
+	}
+
+	b.ReportMetric(float64(bulkInsertRows)*float64(b.N)/b.Elapsed().Seconds(), "rows/sec")
+}
+
+// BenchmarkPgxBatchInsert 用 pgx.Batch 把 bulkInsertRows 条 INSERT 流水线化到一次往返里，
+// 用来和 CopyFrom 对比找出两者的交叉点。
+func BenchmarkPgxBatchInsert(b *testing.B) {
+	ctx := context.Background()
+
+	for b.Loop() {
+		batch := &pgx.Batch{}
+		for j := range bulkInsertRows {
+			batch.Queue("INSERT INTO users (name, email, created_at) VALUES ($1, $2, NOW())",
+				fmt.Sprintf("Pipeline User %d", j), fmt.Sprintf("pipeline_user_%d@example.com", j))
+		}
+
+		br := dbPgx.SendBatch(ctx, batch)
+		for j := 0; j < bulkInsertRows; j++ {
+			if _, err := br.Exec(); err != nil {
+				b.Fatalf("pgx batch insert failed: %v", err)
+			}
+		}
+		if err := br.Close(); err != nil {
+			b.Fatalf("pgx batch close failed: %v", err)
+		}
+	}
+
+	b.ReportMetric(float64(bulkInsertRows)*float64(b.N)/b.Elapsed().Seconds(), "rows/sec")
 }
 
 // =================== 查询基准测试 ===================
@@ -142,3 +219,415 @@ func BenchmarkPgxQuery(b *testing.B) {
 		}
 	}
 }
+
+// =================== 任务队列基准测试（SKIP LOCKED）===================
+
+// QueueJob 对应 queue_jobs 表，GORM 与 pgx 两条路径共用同一张表。
+type QueueJob struct {
+	ID         uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Status     int
+	Tries      int
+	MaxTries   int `gorm:"column:max_tries"`
+	Params     json.RawMessage `gorm:"type:jsonb"`
+	FailReason string          `gorm:"column:fail_reason"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+func (QueueJob) TableName() string {
+	return "queue_jobs"
+}
+
+func (j *QueueJob) BeforeCreate(tx *gorm.DB) error {
+	if j.ID == uuid.Nil {
+		j.ID = uuid.New()
+	}
+	return nil
+}
+
+// dequeueJobSQL 是标准的 Postgres 队列 SKIP LOCKED 出队写法：
+// 在子查询里挑出最早的待处理任务并加锁跳过，外层原子地标记为处理中。
+const dequeueJobSQL = `
+UPDATE queue_jobs
+SET status = 1, tries = tries + 1, updated_at = NOW()
+WHERE id = (
+	SELECT id FROM queue_jobs
+	WHERE status = 0 AND tries < max_tries
+	ORDER BY created_at
+	FOR UPDATE SKIP LOCKED
+	LIMIT 1
+)
+RETURNING id, status, tries, max_tries, params, fail_reason, created_at, updated_at`
+
+func setupQueueJobs() {
+	if err := dbGorm.AutoMigrate(&QueueJob{}); err != nil {
+		log.Fatalf("queue_jobs auto migrate failed: %v", err)
+	}
+	dbGorm.Exec("TRUNCATE TABLE queue_jobs RESTART IDENTITY CASCADE")
+}
+
+// failJob 模拟任务执行失败：记录失败原因，未超过重试上限时任务回到待处理状态，否则标记为失败。
+func failJob(ctx context.Context, id uuid.UUID, reason string) error {
+	_, err := dbPgx.Exec(ctx, `
+		UPDATE queue_jobs
+		SET status = CASE WHEN tries >= max_tries THEN 2 ELSE 0 END,
+		    fail_reason = $2
+		WHERE id = $1`, id, reason)
+	return err
+}
+
+func BenchmarkGormQueueEnqueueDequeue(b *testing.B) {
+	setupQueueJobs()
+
+	for i := 0; b.Loop(); i++ {
+		job := QueueJob{MaxTries: 5, Params: json.RawMessage(`{"work":"gorm"}`)}
+		if err := dbGorm.Create(&job).Error; err != nil {
+			b.Fatalf("gorm enqueue failed: %v", err)
+		}
+
+		var dequeued QueueJob
+		if err := dbGorm.Raw(dequeueJobSQL).Scan(&dequeued).Error; err != nil {
+			b.Fatalf("gorm dequeue failed: %v", err)
+		}
+
+		if i%10 == 0 {
+			if err := failJob(context.Background(), dequeued.ID, "simulated worker panic"); err != nil {
+				b.Fatalf("gorm fail-job failed: %v", err)
+			}
+		}
+	}
+}
+
+func BenchmarkPgxQueueEnqueueDequeue(b *testing.B) {
+	setupQueueJobs()
+	ctx := context.Background()
+
+	for i := 0; b.Loop(); i++ {
+		var id uuid.UUID
+		err := dbPgx.QueryRow(ctx,
+			"INSERT INTO queue_jobs (status, tries, max_tries, params, fail_reason, created_at, updated_at) VALUES (0, 0, 5, $1, '', NOW(), NOW()) RETURNING id",
+			[]byte(`{"work":"pgx"}`),
+		).Scan(&id)
+		if err != nil {
+			b.Fatalf("pgx enqueue failed: %v", err)
+		}
+
+		var dequeued QueueJob
+		row := dbPgx.QueryRow(ctx, dequeueJobSQL)
+		if err := row.Scan(&dequeued.ID, &dequeued.Status, &dequeued.Tries, &dequeued.MaxTries, &dequeued.Params, &dequeued.FailReason, &dequeued.CreatedAt, &dequeued.UpdatedAt); err != nil {
+			b.Fatalf("pgx dequeue failed: %v", err)
+		}
+
+		if i%10 == 0 {
+			if err := failJob(ctx, dequeued.ID, "simulated worker panic"); err != nil {
+				b.Fatalf("pgx fail-job failed: %v", err)
+			}
+		}
+	}
+}
+
+// BenchmarkPgxQueueEnqueueDequeueParallel 用多个 worker 并发抢同一批待处理任务，
+// 衡量 SKIP LOCKED 在高并发下的争用开销。每个 worker 在出队前先补一条新任务，
+// 让队列长度保持稳定，避免 b.N 超出预填充数量后 dequeueJobSQL 无行可取。
+func BenchmarkPgxQueueEnqueueDequeueParallel(b *testing.B) {
+	setupQueueJobs()
+	ctx := context.Background()
+
+	const prefill = 64
+	for i := 0; i < prefill; i++ {
+		_, err := dbPgx.Exec(ctx, "INSERT INTO queue_jobs (status, tries, max_tries, params, fail_reason, created_at, updated_at) VALUES (0, 0, 5, $1, '', NOW(), NOW())", []byte(`{}`))
+		if err != nil {
+			b.Fatalf("pgx prefill failed: %v", err)
+		}
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var dequeued QueueJob
+		for pb.Next() {
+			if _, err := dbPgx.Exec(ctx, "INSERT INTO queue_jobs (status, tries, max_tries, params, fail_reason, created_at, updated_at) VALUES (0, 0, 5, $1, '', NOW(), NOW())", []byte(`{}`)); err != nil {
+				b.Fatalf("pgx replenish failed: %v", err)
+			}
+
+			row := dbPgx.QueryRow(ctx, dequeueJobSQL)
+			if err := row.Scan(&dequeued.ID, &dequeued.Status, &dequeued.Tries, &dequeued.MaxTries, &dequeued.Params, &dequeued.FailReason, &dequeued.CreatedAt, &dequeued.UpdatedAt); err != nil {
+				b.Fatalf("pgx parallel dequeue failed: %v", err)
+			}
+		}
+	})
+}
+
+// =================== 事务基准测试 ===================
+
+func BenchmarkGormTx(b *testing.B) {
+	for i := 0; b.Loop(); i++ {
+		err := dbGorm.Transaction(func(tx *gorm.DB) error {
+			user := User{Name: fmt.Sprintf("Tx User %d", i), Email: fmt.Sprintf("tx_user_%d@example.com", i)}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&user).Update("name", user.Name+" Updated").Error; err != nil {
+				return err
+			}
+			var fetched User
+			return tx.First(&fetched, user.ID).Error
+		})
+		if err != nil {
+			b.Fatalf("gorm tx failed: %v", err)
+		}
+	}
+}
+
+func BenchmarkPgxTx(b *testing.B) {
+	ctx := context.Background()
+
+	for i := 0; b.Loop(); i++ {
+		err := func() error {
+			tx, err := dbPgx.BeginTx(ctx, pgx.TxOptions{})
+			if err != nil {
+				return err
+			}
+			defer tx.Rollback(ctx)
+
+			name := fmt.Sprintf("Tx User %d", i)
+			email := fmt.Sprintf("tx_user_%d@example.com", i)
+			var id uint
+			if err := tx.QueryRow(ctx, "INSERT INTO users (name, email, created_at) VALUES ($1, $2, NOW()) RETURNING id", name, email).Scan(&id); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(ctx, "UPDATE users SET name = $1 WHERE id = $2", name+" Updated", id); err != nil {
+				return err
+			}
+			var fetchedName string
+			if err := tx.QueryRow(ctx, "SELECT name FROM users WHERE id = $1", id).Scan(&fetchedName); err != nil {
+				return err
+			}
+			return tx.Commit(ctx)
+		}()
+		if err != nil {
+			b.Fatalf("pgx tx failed: %v", err)
+		}
+	}
+}
+
+const maxSerializableRetries = 5
+
+// isRetriableTxConflict reports whether err is a Postgres conflict that a
+// transaction retry can resolve: 40001 (serialization_failure) from SSI, or
+// 40P01 (deadlock_detected) from the deadlock detector. Taking the two rows
+// in opposite order between the two goroutines below is a textbook circular
+// wait, and row locks from FOR UPDATE are acquired immediately via 2PL
+// regardless of isolation level, so 40P01 shows up here just as often as
+// 40001 and must be retried the same way.
+func isRetriableTxConflict(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "40001" || pgErr.Code == "40P01"
+	}
+	return false
+}
+
+// serializableBackoff 返回第 attempt 次重试前的指数退避时长：1ms, 2ms, 4ms...
+func serializableBackoff(attempt int) time.Duration {
+	return time.Millisecond * time.Duration(1<<attempt)
+}
+
+// BenchmarkGormSerializableRetry 用两个并发 goroutine 以相反顺序更新同一对行，
+// 在 SERIALIZABLE 隔离级别下制造序列化冲突，并验证重试循环的开销。
+func BenchmarkGormSerializableRetry(b *testing.B) {
+	prepareDataForQuery(2)
+
+	runTx := func(first, second uint) error {
+		var err error
+		for attempt := 0; attempt < maxSerializableRetries; attempt++ {
+			err = dbGorm.Transaction(func(tx *gorm.DB) error {
+				var u1, u2 User
+				if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&u1, first).Error; err != nil {
+					return err
+				}
+				if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&u2, second).Error; err != nil {
+					return err
+				}
+				if err := tx.Model(&u1).Update("name", u1.Name+"+").Error; err != nil {
+					return err
+				}
+				return tx.Model(&u2).Update("name", u2.Name+"+").Error
+			}, &sql.TxOptions{Isolation: sql.LevelSerializable})
+			if err == nil {
+				return nil
+			}
+			if !isRetriableTxConflict(err) {
+				return err
+			}
+			time.Sleep(serializableBackoff(attempt))
+		}
+		return err
+	}
+
+	for b.Loop() {
+		var wg sync.WaitGroup
+		errs := make([]error, 2)
+		wg.Add(2)
+		go func() { defer wg.Done(); errs[0] = runTx(1, 2) }()
+		go func() { defer wg.Done(); errs[1] = runTx(2, 1) }()
+		wg.Wait()
+		for _, err := range errs {
+			if err != nil {
+				b.Fatalf("gorm serializable tx failed: %v", err)
+			}
+		}
+	}
+}
+
+func BenchmarkPgxSerializableRetry(b *testing.B) {
+	ctx := context.Background()
+	prepareDataForQuery(2)
+
+	runTx := func(first, second uint) error {
+		var err error
+		for attempt := 0; attempt < maxSerializableRetries; attempt++ {
+			err = func() error {
+				tx, err := dbPgx.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.Serializable})
+				if err != nil {
+					return err
+				}
+				defer tx.Rollback(ctx)
+
+				var name1, name2 string
+				if err := tx.QueryRow(ctx, "SELECT name FROM users WHERE id = $1 FOR UPDATE", first).Scan(&name1); err != nil {
+					return err
+				}
+				if err := tx.QueryRow(ctx, "SELECT name FROM users WHERE id = $1 FOR UPDATE", second).Scan(&name2); err != nil {
+					return err
+				}
+				if _, err := tx.Exec(ctx, "UPDATE users SET name = $1 WHERE id = $2", name1+"+", first); err != nil {
+					return err
+				}
+				if _, err := tx.Exec(ctx, "UPDATE users SET name = $1 WHERE id = $2", name2+"+", second); err != nil {
+					return err
+				}
+				return tx.Commit(ctx)
+			}()
+			if err == nil {
+				return nil
+			}
+			if !isRetriableTxConflict(err) {
+				return err
+			}
+			time.Sleep(serializableBackoff(attempt))
+		}
+		return err
+	}
+
+	for b.Loop() {
+		var wg sync.WaitGroup
+		errs := make([]error, 2)
+		wg.Add(2)
+		go func() { defer wg.Done(); errs[0] = runTx(1, 2) }()
+		go func() { defer wg.Done(); errs[1] = runTx(2, 1) }()
+		wg.Wait()
+		for _, err := range errs {
+			if err != nil {
+				b.Fatalf("pgx serializable tx failed: %v", err)
+			}
+		}
+	}
+}
+
+// =================== 预编译语句与 pgx 流水线基准测试 ===================
+
+// BenchmarkPgxPrepared 只 Prepare 一次语句并在整个基准循环中复用，
+// 和依赖连接池默认自动语句缓存的 BenchmarkPgxQuery 对比显式预编译的开销。
+func BenchmarkPgxPrepared(b *testing.B) {
+	b.ReportAllocs()
+
+	const totalUsers = 1000
+	prepareDataForQuery(totalUsers)
+
+	ctx := context.Background()
+	conn, err := dbPgx.Acquire(ctx)
+	if err != nil {
+		b.Fatalf("pgx acquire failed: %v", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Conn().Prepare(ctx, "sel_user", "SELECT name, email, created_at FROM users WHERE id = $1"); err != nil {
+		b.Fatalf("pgx prepare failed: %v", err)
+	}
+
+	for b.Loop() {
+		randomID := rand.Intn(totalUsers) + 1
+		var name, email string
+		var createdAt time.Time
+		if err := conn.QueryRow(ctx, "sel_user", randomID).Scan(&name, &email, &createdAt); err != nil {
+			b.Fatalf("pgx prepared query failed: %v", err)
+		}
+	}
+}
+
+// BenchmarkPgxPipeline 用 SendBatch 把多条查询排进一次流水线里，
+// 衡量 pgx v5 管道模式相对逐条往返的收益。
+func BenchmarkPgxPipeline(b *testing.B) {
+	b.ReportAllocs()
+
+	const totalUsers = 1000
+	const pipelineBatchSize = 100
+	prepareDataForQuery(totalUsers)
+
+	ctx := context.Background()
+	conn, err := dbPgx.Acquire(ctx)
+	if err != nil {
+		b.Fatalf("pgx acquire failed: %v", err)
+	}
+	defer conn.Release()
+
+	for b.Loop() {
+		batch := &pgx.Batch{}
+		for j := 0; j < pipelineBatchSize; j++ {
+			randomID := rand.Intn(totalUsers) + 1
+			batch.Queue("SELECT name, email, created_at FROM users WHERE id = $1", randomID)
+		}
+
+		br := conn.SendBatch(ctx, batch)
+		for j := 0; j < pipelineBatchSize; j++ {
+			var name, email string
+			var createdAt time.Time
+			if err := br.QueryRow().Scan(&name, &email, &createdAt); err != nil {
+				b.Fatalf("pgx pipeline query failed: %v", err)
+			}
+		}
+		if err := br.Close(); err != nil {
+			b.Fatalf("pgx pipeline close failed: %v", err)
+		}
+	}
+}
+
+// BenchmarkGormPreparedOff 打开第二个不开启语句缓存的 *gorm.DB，
+// 单独衡量 PrepareStmt 对 GORM 查询路径的影响。
+func BenchmarkGormPreparedOff(b *testing.B) {
+	b.ReportAllocs()
+
+	const totalUsers = 1000
+	prepareDataForQuery(totalUsers)
+
+	dbGormNoPrepare, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
+		Logger:      logger.Default.LogMode(logger.Silent),
+		PrepareStmt: false,
+	})
+	if err != nil {
+		b.Fatalf("failed to open gorm db without prepared statements: %v", err)
+	}
+	sqlDB, err := dbGormNoPrepare.DB()
+	if err != nil {
+		b.Fatalf("failed to get underlying sql.DB: %v", err)
+	}
+	defer sqlDB.Close()
+
+	for b.Loop() {
+		randomID := rand.Intn(totalUsers) + 1
+		var user User
+		if err := dbGormNoPrepare.First(&user, randomID).Error; err != nil {
+			b.Fatalf("gorm (no prepare) query failed: %v", err)
+		}
+	}
+}